@@ -0,0 +1,126 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+
+	"tabell/rss/internal/deliver"
+)
+
+// Delivered records that an Article has already been appended to the
+// IMAP mailbox, so re-running the deliver command doesn't duplicate it.
+type Delivered struct {
+	gorm.Model
+	ArticleID uint `gorm:"uniqueIndex"`
+}
+
+func isDelivered(db *gorm.DB, articleID uint) bool {
+	var d Delivered
+	err := db.Where(&Delivered{ArticleID: articleID}).First(&d).Error
+	return err == nil
+}
+
+func markDelivered(db *gorm.DB, articleID uint) error {
+	return db.Create(&Delivered{ArticleID: articleID}).Error
+}
+
+// deliverArticles appends every unread, not-yet-delivered Article (at
+// most 500 per run) to the configured IMAP mailbox, filing each one
+// under folderTemplate (e.g. "Feeds/{{.Category}}/{{.FeedTitle}}").
+func deliverArticles(db *gorm.DB, cfg deliver.Config, folderTemplate string) error {
+	var articles []Article
+	err := db.Where("read = ?", false).
+		Where("id NOT IN (?)", db.Model(&Delivered{}).Select("article_id")).
+		Limit(500).Find(&articles).Error
+	if err != nil {
+		return fmt.Errorf("db loading error: %v", err)
+	}
+
+	conn, err := deliver.Dial(cfg)
+	if err != nil {
+		return fmt.Errorf("couldnt connect to IMAP server: %w", err)
+	}
+	defer conn.Close()
+
+	delivered := 0
+	for _, article := range articles {
+		if isDelivered(db, article.ID) {
+			continue
+		}
+
+		var feed Feed
+		if err := db.First(&feed, article.FeedID).Error; err != nil {
+			log.Printf("Error loading feed %d for article %d: %v", article.FeedID, article.ID, err)
+			continue
+		}
+
+		category := "Uncategorized"
+		var tags []Tag
+		if err := db.Model(&feed).Association("Tags").Find(&tags); err == nil && len(tags) > 0 {
+			category = tags[0].Name
+		}
+
+		feedTitle := feed.Title
+		if feedTitle == "" {
+			feedTitle = feed.URL
+		}
+
+		a := deliver.Article{
+			GUID:        fmt.Sprintf("%d", article.ID),
+			Title:       article.Title,
+			Link:        article.Link,
+			Description: article.Description,
+			Published:   article.Published,
+			FeedTitle:   feedTitle,
+			Category:    category,
+		}
+
+		folder, err := deliver.FolderName(folderTemplate, a)
+		if err != nil {
+			return fmt.Errorf("couldnt build folder name: %w", err)
+		}
+
+		msg, err := deliver.BuildMessage(a)
+		if err != nil {
+			log.Printf("Error building message for article %d: %v", article.ID, err)
+			continue
+		}
+
+		deliverTime := article.Published
+		if deliverTime.IsZero() {
+			deliverTime = time.Now()
+		}
+		if err := conn.Append(folder, msg, deliverTime); err != nil {
+			log.Printf("Error delivering article %d to %s: %v", article.ID, folder, err)
+			continue
+		}
+
+		if err := markDelivered(db, article.ID); err != nil {
+			log.Printf("Error recording delivery of article %d: %v", article.ID, err)
+		}
+		delivered++
+	}
+
+	log.Printf("Delivered %d articles", delivered)
+	return nil
+}
+
+// deliverFlags parses the "deliver" subcommand's flags.
+func deliverFlags(args []string) (deliver.Config, string, error) {
+	fs := flag.NewFlagSet("deliver", flag.ExitOnError)
+	addr := fs.String("addr", "", "IMAP server address (host:port)")
+	username := fs.String("user", "", "IMAP username")
+	password := fs.String("password", "", "IMAP password")
+	folderTemplate := fs.String("folder", "Feeds/{{.Category}}/{{.FeedTitle}}", "folder path template, e.g. Feeds/{{.Category}}/{{.FeedTitle}}")
+	fs.Parse(args)
+
+	if *addr == "" || *username == "" {
+		return deliver.Config{}, "", fmt.Errorf("usage: deliver -addr <host:port> -user <user> -password <password> [-folder <template>]")
+	}
+
+	return deliver.Config{Addr: *addr, Username: *username, Password: *password}, *folderTemplate, nil
+}
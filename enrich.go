@@ -0,0 +1,139 @@
+package main
+
+import (
+	"log"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+
+	"github.com/blevesearch/bleve"
+	"github.com/go-shiori/go-readability"
+	"gorm.io/gorm"
+)
+
+const (
+	// shortDescriptionThreshold is how many runes a Description can have
+	// before we consider the feed's excerpt good enough on its own. Most
+	// feeds that only publish short teasers stay well under this.
+	shortDescriptionThreshold = 280
+
+	enrichConcurrency  = 4
+	enrichTimeout      = 30 * time.Second
+	enrichHostInterval = 2 * time.Second
+)
+
+// ArticlesNeedingEnrichment returns Articles that haven't been
+// enriched yet (no Content) and whose feed Description looks like a
+// short excerpt rather than the full text.
+func ArticlesNeedingEnrichment(db *gorm.DB, maxArticles int) ([]Article, error) {
+	var candidates []Article
+	if err := db.Where("content = ?", "").Limit(maxArticles * 2).Find(&candidates).Error; err != nil {
+		return nil, err
+	}
+
+	var articles []Article
+	for _, a := range candidates {
+		if utf8.RuneCountInString(a.Description) < shortDescriptionThreshold {
+			articles = append(articles, a)
+		}
+		if len(articles) >= maxArticles {
+			break
+		}
+	}
+	return articles, nil
+}
+
+// hostThrottle enforces a minimum interval between requests to the
+// same host, independent of the overall concurrency limit.
+type hostThrottle struct {
+	mu       sync.Mutex
+	interval time.Duration
+	last     map[string]time.Time
+}
+
+func newHostThrottle(interval time.Duration) *hostThrottle {
+	return &hostThrottle{interval: interval, last: make(map[string]time.Time)}
+}
+
+func (t *hostThrottle) Wait(host string) {
+	t.mu.Lock()
+	var wait time.Duration
+	if last, ok := t.last[host]; ok {
+		if elapsed := time.Since(last); elapsed < t.interval {
+			wait = t.interval - elapsed
+		}
+	}
+	t.last[host] = time.Now().Add(wait)
+	t.mu.Unlock()
+
+	if wait > 0 {
+		time.Sleep(wait)
+	}
+}
+
+// enrichArticles downloads Link and extracts the main article body via
+// readability for every Article returned by ArticlesNeedingEnrichment,
+// storing the result in Content/PlainContent and re-indexing. Fetches
+// run with up to concurrency in flight, bounded additionally by a
+// per-host minimum interval of hostInterval.
+func enrichArticles(db *gorm.DB, index bleve.Index, concurrency int, timeout, hostInterval time.Duration) error {
+	articles, err := ArticlesNeedingEnrichment(db, 500)
+	if err != nil {
+		return err
+	}
+	log.Printf("Enriching %d articles", len(articles))
+
+	throttle := newHostThrottle(hostInterval)
+	sem := make(chan struct{}, concurrency)
+	articleCh := make(chan Article)
+
+	var indexWG sync.WaitGroup
+	indexWG.Add(1)
+	go func() {
+		defer indexWG.Done()
+		if err := batchIndexChannel(index, articleCh, defaultIndexBatchSize); err != nil {
+			log.Printf("Error batch indexing enriched articles: %v", err)
+		}
+	}()
+
+	var enriched int64
+	var wg sync.WaitGroup
+	for _, a := range articles {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(a Article) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			link, err := url.Parse(a.Link)
+			if err != nil {
+				log.Printf("Error parsing link %q for article %d: %v", a.Link, a.ID, err)
+				return
+			}
+			throttle.Wait(link.Host)
+
+			extracted, err := readability.FromURL(a.Link, timeout)
+			if err != nil {
+				log.Printf("Error extracting readable content from %s: %v", a.Link, err)
+				return
+			}
+
+			a.Content = extracted.Content
+			a.PlainContent = extracted.TextContent
+			if err := db.Save(&a).Error; err != nil {
+				log.Printf("Error saving enriched article %d: %v", a.ID, err)
+				return
+			}
+			articleCh <- a
+			atomic.AddInt64(&enriched, 1)
+		}(a)
+	}
+	wg.Wait()
+	close(articleCh)
+	indexWG.Wait()
+
+	log.Printf("Enriched %d articles", enriched)
+	return nil
+}
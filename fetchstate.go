@@ -0,0 +1,144 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// maxSeenHashes bounds how many content hashes we remember per feed.
+// Once the list is full, the hashes recorded longest ago are dropped as
+// new ones are added, so a feed that's been running for years doesn't
+// grow its FetchState forever. Seeing an item again does not move its
+// hash to the front: trimming follows the order hashes were first
+// recorded, not how recently each item was seen.
+const maxSeenHashes = 1000
+
+// FetchState tracks the conditional-GET validators and per-item
+// dedupe history for a single Feed, so restarting the process (or
+// pruning Articles out of the db) doesn't cause previously-seen items
+// to be re-imported.
+type FetchState struct {
+	gorm.Model
+	FeedID       uint   `gorm:"uniqueIndex"`
+	ETag         string `json:"etag"`
+	LastModified string `json:"last_modified"`
+	// SeenHashes is a JSON-encoded list of content hashes, most recently
+	// recorded first.
+	SeenHashes string `json:"-"`
+}
+
+func LoadFetchState(db *gorm.DB, feedID uint) (*FetchState, error) {
+	var fs FetchState
+	result := db.Where(&FetchState{FeedID: feedID}).FirstOrCreate(&fs, &FetchState{FeedID: feedID})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected > 0 {
+		// Brand-new FetchState: this feed may already have Articles from
+		// before this dedupe history existed, so seed it from them rather
+		// than treating everything currently in the feed as new.
+		seedFetchState(db, &fs)
+	}
+	return &fs, nil
+}
+
+// seedFetchState backfills a freshly-created FetchState's SeenHashes from
+// Articles already stored for feedID, so upgrading an existing install
+// doesn't re-create every item currently in the feed as a "new" unread
+// Article. This is necessarily best-effort: Article doesn't retain the
+// item's original GUID or raw Published string, so the hash is
+// reconstructed from Link, Title, and Published formatted as RFC1123Z
+// (one of the formats attemptTimeParse accepts, and the most common
+// pubDate format in the wild). Feeds that rely on GUID for identity, or that use
+// a different date format, will still see their existing items
+// re-imported once on upgrade; this only removes the common case.
+func seedFetchState(db *gorm.DB, fs *FetchState) {
+	var articles []Article
+	if err := db.Where(&Article{FeedID: int(fs.FeedID)}).Find(&articles).Error; err != nil {
+		return
+	}
+	for _, a := range articles {
+		fs.MarkSeen(ContentHash("", a.Link, a.Title, a.Published.Format(time.RFC1123Z)))
+	}
+}
+
+func (fs *FetchState) hashes() []string {
+	if fs.SeenHashes == "" {
+		return nil
+	}
+	var hashes []string
+	if err := json.Unmarshal([]byte(fs.SeenHashes), &hashes); err != nil {
+		return nil
+	}
+	return hashes
+}
+
+// HasSeen reports whether hash has already been recorded for this feed.
+func (fs *FetchState) HasSeen(hash string) bool {
+	for _, h := range fs.hashes() {
+		if h == hash {
+			return true
+		}
+	}
+	return false
+}
+
+// MarkSeen records hash as seen, trimming the oldest entries once the
+// set grows past maxSeenHashes.
+func (fs *FetchState) MarkSeen(hash string) {
+	hashes := append([]string{hash}, fs.hashes()...)
+	if len(hashes) > maxSeenHashes {
+		hashes = hashes[:maxSeenHashes]
+	}
+	encoded, err := json.Marshal(hashes)
+	if err != nil {
+		return
+	}
+	fs.SeenHashes = string(encoded)
+}
+
+// ContentHash computes a stable SHA-256 fingerprint for a feed item so
+// it can be deduped even when its publish date is missing, malformed,
+// or reused across items - all of which are common enough in the wild
+// that relying on pubDate.After(feed.LastCheckedTime) alone misses items.
+func ContentHash(guid, link, title, published string) string {
+	sum := sha256.Sum256([]byte(guid + "||" + link + "||" + title + "||" + published))
+	return hex.EncodeToString(sum[:])
+}
+
+// conditionalTransport adds If-None-Match/If-Modified-Since validators
+// to outgoing requests and records whatever ETag/Last-Modified the
+// server sends back, so callers can persist them for the next fetch.
+type conditionalTransport struct {
+	base            http.RoundTripper
+	ifNoneMatch     string
+	ifModifiedSince string
+
+	etag         string
+	lastModified string
+}
+
+func (t *conditionalTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.ifNoneMatch != "" {
+		req.Header.Set("If-None-Match", t.ifNoneMatch)
+	}
+	if t.ifModifiedSince != "" {
+		req.Header.Set("If-Modified-Since", t.ifModifiedSince)
+	}
+
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	resp, err := base.RoundTrip(req)
+	if err == nil && resp != nil {
+		t.etag = resp.Header.Get("ETag")
+		t.lastModified = resp.Header.Get("Last-Modified")
+	}
+	return resp, err
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/blevesearch/bleve"
+	"github.com/blevesearch/bleve/analysis/analyzer/keyword"
+	"github.com/blevesearch/bleve/mapping"
+
+	"tabell/rss/internal/htmlutil"
+)
+
+const (
+	// defaultIndexBatchSize is how many documents each indexing worker
+	// accumulates before flushing a bleve.Batch, unless overridden via
+	// the -batch-size flag.
+	defaultIndexBatchSize = 200
+	// indexWorkers is the number of goroutines concurrently consuming
+	// articles off the indexing channel and building batches.
+	indexWorkers = 4
+)
+
+// indexableArticle is what we actually hand to bleve: a flattened view
+// of Article with FeedID/ID as keyword fields and PlainContent as the
+// primary analyzed body - it's the readability-extracted full text
+// when available (set by `enrich`), falling back to the HTML-stripped
+// feed Description otherwise.
+type indexableArticle struct {
+	ID           string
+	FeedID       string
+	Title        string
+	Description  string
+	PlainContent string
+	Published    time.Time
+	Fetched      time.Time
+}
+
+func newIndexableArticle(a Article) indexableArticle {
+	plainContent := a.PlainContent
+	if plainContent == "" {
+		plainContent = htmlutil.StripHTML(a.Description)
+	}
+	return indexableArticle{
+		ID:           fmt.Sprintf("%d", a.ID),
+		FeedID:       fmt.Sprintf("%d", a.FeedID),
+		Title:        a.Title,
+		Description:  htmlutil.StripHTML(a.Description),
+		PlainContent: plainContent,
+		Published:    a.Published,
+		Fetched:      a.Fetched,
+	}
+}
+
+// buildIndexMapping constructs the document mapping used for the
+// article index: FeedID/ID are unanalyzed keyword fields excluded from
+// the `_all` field, Published/Fetched are proper datetime fields (so
+// search can eventually support date-range queries), and PlainContent
+// is the primary analyzed body field.
+func buildIndexMapping() *mapping.IndexMappingImpl {
+	keywordFieldMapping := bleve.NewTextFieldMapping()
+	keywordFieldMapping.Analyzer = keyword.Name
+	keywordFieldMapping.IncludeInAll = false
+
+	dateFieldMapping := bleve.NewDateTimeFieldMapping()
+
+	bodyFieldMapping := bleve.NewTextFieldMapping()
+
+	articleMapping := bleve.NewDocumentMapping()
+	articleMapping.AddFieldMappingsAt("ID", keywordFieldMapping)
+	articleMapping.AddFieldMappingsAt("FeedID", keywordFieldMapping)
+	articleMapping.AddFieldMappingsAt("Published", dateFieldMapping)
+	articleMapping.AddFieldMappingsAt("Fetched", dateFieldMapping)
+	articleMapping.AddFieldMappingsAt("PlainContent", bodyFieldMapping)
+
+	indexMapping := bleve.NewIndexMapping()
+	indexMapping.DefaultMapping = articleMapping
+	return indexMapping
+}
+
+// batchIndexArticles indexes articles through the same worker pool
+// used by the live-fetch path, closing the channel once every article
+// has been handed off.
+func batchIndexArticles(index bleve.Index, articles []Article, batchSize int) error {
+	articleCh := make(chan Article)
+	go func() {
+		defer close(articleCh)
+		for _, a := range articles {
+			articleCh <- a
+		}
+	}()
+	return batchIndexChannel(index, articleCh, batchSize)
+}
+
+// batchIndexChannel drains articleCh with indexWorkers goroutines,
+// each flushing a bleve.Batch every batchSize documents (and once more
+// when the channel closes). This replaces calling index.Index() once
+// per article, which was the dominant cost when indexing thousands of
+// articles from scratch.
+func batchIndexChannel(index bleve.Index, articleCh <-chan Article, batchSize int) error {
+	var wg sync.WaitGroup
+	errCh := make(chan error, indexWorkers)
+
+	for i := 0; i < indexWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			batch := index.NewBatch()
+			for a := range articleCh {
+				if err := batch.Index(fmt.Sprintf("%d", a.ID), newIndexableArticle(a)); err != nil {
+					errCh <- fmt.Errorf("couldnt add article %d to batch: %w", a.ID, err)
+					continue
+				}
+				if batch.Size() >= batchSize {
+					if err := index.Batch(batch); err != nil {
+						errCh <- fmt.Errorf("couldnt flush batch: %w", err)
+					}
+					batch = index.NewBatch()
+				}
+			}
+			if batch.Size() > 0 {
+				if err := index.Batch(batch); err != nil {
+					errCh <- fmt.Errorf("couldnt flush final batch: %w", err)
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+	close(errCh)
+
+	var firstErr error
+	for err := range errCh {
+		log.Printf("indexing error: %v", err)
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
@@ -0,0 +1,66 @@
+package deliver
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"time"
+
+	"github.com/emersion/go-imap/client"
+)
+
+// Config holds the IMAP server and credentials used to deliver
+// messages.
+type Config struct {
+	Addr     string // host:port
+	Username string
+	Password string
+	// InsecureSkipVerify disables TLS certificate verification; only
+	// meant for testing against a local/self-signed IMAP server.
+	InsecureSkipVerify bool
+}
+
+// Conn is a logged-in IMAP session used to append many messages
+// without reconnecting for each one. Callers should Close it when
+// done delivering.
+type Conn struct {
+	client  *client.Client
+	created map[string]bool
+}
+
+// Dial connects to cfg's IMAP server and logs in, returning a Conn
+// that can be reused to Append many messages across a delivery run.
+func Dial(cfg Config) (*Conn, error) {
+	c, err := client.DialTLS(cfg.Addr, &tls.Config{InsecureSkipVerify: cfg.InsecureSkipVerify})
+	if err != nil {
+		return nil, fmt.Errorf("couldnt connect to %s: %w", cfg.Addr, err)
+	}
+
+	if err := c.Login(cfg.Username, cfg.Password); err != nil {
+		c.Logout()
+		return nil, fmt.Errorf("couldnt log in to %s: %w", cfg.Addr, err)
+	}
+
+	return &Conn{client: c, created: make(map[string]bool)}, nil
+}
+
+// Append appends msg to folder, creating the folder the first time
+// it's seen on this Conn (best-effort: if it already exists, Create
+// returns an error we can ignore).
+func (conn *Conn) Append(folder string, msg []byte, date time.Time) error {
+	if !conn.created[folder] {
+		conn.client.Create(folder)
+		conn.created[folder] = true
+	}
+
+	literal := bytes.NewReader(msg)
+	if err := conn.client.Append(folder, nil, date, literal); err != nil {
+		return fmt.Errorf("couldnt append message to %s: %w", folder, err)
+	}
+	return nil
+}
+
+// Close logs out of the IMAP server.
+func (conn *Conn) Close() error {
+	return conn.client.Logout()
+}
@@ -0,0 +1,112 @@
+// Package deliver turns Articles into RFC 5322 email messages and
+// appends them to an IMAP mailbox, so subscriptions can be read from
+// any mail client.
+package deliver
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net/mail"
+	"strings"
+	"text/template"
+	"time"
+
+	"tabell/rss/internal/htmlutil"
+)
+
+// Article is the subset of article/feed data needed to render a
+// message. It's a plain struct (rather than the caller's gorm model)
+// so this package has no dependency on the database layer.
+type Article struct {
+	GUID        string
+	Title       string
+	Link        string
+	Description string
+	Published   time.Time
+	FeedTitle   string
+	Category    string
+}
+
+// FolderName evaluates tmpl (e.g. "Feeds/{{.Category}}/{{.FeedTitle}}")
+// against a.
+func FolderName(tmpl string, a Article) (string, error) {
+	t, err := template.New("folder").Parse(tmpl)
+	if err != nil {
+		return "", fmt.Errorf("couldnt parse folder template %q: %w", tmpl, err)
+	}
+
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, a); err != nil {
+		return "", fmt.Errorf("couldnt render folder template %q: %w", tmpl, err)
+	}
+	return buf.String(), nil
+}
+
+// BuildMessage renders a as a multipart/alternative RFC 5322 message
+// with an HTML part (a.Description verbatim) and a plaintext fallback
+// (a.Description with tags stripped).
+func BuildMessage(a Article) ([]byte, error) {
+	from := mail.Address{Name: a.FeedTitle, Address: "feed@local"}
+	boundary := "rss-" + messageID(a)
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", from.String())
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", a.Title))
+	fmt.Fprintf(&buf, "Date: %s\r\n", a.Published.Format(time.RFC1123Z))
+	fmt.Fprintf(&buf, "Message-ID: <%s>\r\n", messageID(a))
+	if a.Link != "" {
+		fmt.Fprintf(&buf, "X-RSS-Link: %s\r\n", a.Link)
+	}
+	fmt.Fprintf(&buf, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&buf, "Content-Type: multipart/alternative; boundary=%q\r\n", boundary)
+	fmt.Fprintf(&buf, "\r\n")
+
+	plain := strings.TrimSpace(htmlutil.StripHTML(a.Description))
+
+	fmt.Fprintf(&buf, "--%s\r\n", boundary)
+	fmt.Fprintf(&buf, "Content-Type: text/plain; charset=utf-8\r\n")
+	fmt.Fprintf(&buf, "Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+	qp := quotedprintable.NewWriter(&buf)
+	if _, err := qp.Write([]byte(plain)); err != nil {
+		return nil, fmt.Errorf("couldnt write plaintext part: %w", err)
+	}
+	if err := qp.Close(); err != nil {
+		return nil, fmt.Errorf("couldnt close plaintext part: %w", err)
+	}
+	fmt.Fprintf(&buf, "\r\n")
+
+	fmt.Fprintf(&buf, "--%s\r\n", boundary)
+	fmt.Fprintf(&buf, "Content-Type: text/html; charset=utf-8\r\n")
+	fmt.Fprintf(&buf, "Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+	qp = quotedprintable.NewWriter(&buf)
+	if _, err := qp.Write([]byte(a.Description)); err != nil {
+		return nil, fmt.Errorf("couldnt write html part: %w", err)
+	}
+	if err := qp.Close(); err != nil {
+		return nil, fmt.Errorf("couldnt close html part: %w", err)
+	}
+	fmt.Fprintf(&buf, "\r\n--%s--\r\n", boundary)
+
+	return buf.Bytes(), nil
+}
+
+// messageID derives a stable Message-ID local-part from the article's
+// GUID (falling back to its link) so re-delivering the same article
+// produces byte-identical headers.
+func messageID(a Article) string {
+	seed := a.GUID
+	if seed == "" {
+		seed = a.Link
+	}
+	seed = strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		default:
+			return '-'
+		}
+	}, seed)
+	return seed + "@rss.local"
+}
@@ -0,0 +1,15 @@
+// Package htmlutil holds small HTML-handling helpers shared between
+// packages that can't depend on each other (e.g. main and
+// internal/deliver).
+package htmlutil
+
+import "regexp"
+
+var tagPattern = regexp.MustCompile(`<[^>]*>`)
+
+// StripHTML removes markup from s, leaving plain text. It's
+// intentionally simple (no entity decoding) since feed descriptions
+// are rarely more than a paragraph of basic markup.
+func StripHTML(s string) string {
+	return tagPattern.ReplaceAllString(s, "")
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// opml and outline mirror the OPML 2.0 subscription-list format used by
+// most feed readers: a flat or nested list of <outline> elements, where
+// outlines with child outlines act as folders/categories and leaf
+// outlines with an xmlUrl attribute represent a single feed.
+type opml struct {
+	XMLName xml.Name `xml:"opml"`
+	Version string   `xml:"version,attr"`
+	Head    opmlHead `xml:"head"`
+	Body    opmlBody `xml:"body"`
+}
+
+type opmlHead struct {
+	Title string `xml:"title"`
+}
+
+type opmlBody struct {
+	Outlines []outline `xml:"outline"`
+}
+
+type outline struct {
+	Text     string    `xml:"text,attr"`
+	Title    string    `xml:"title,attr,omitempty"`
+	XMLURL   string    `xml:"xmlUrl,attr,omitempty"`
+	HTMLURL  string    `xml:"htmlUrl,attr,omitempty"`
+	Outlines []outline `xml:"outline,omitempty"`
+}
+
+// ImportOPML reads an OPML subscription list from path and creates a
+// Feed for every leaf outline (one with an xmlUrl). Outlines that
+// contain nested outlines are treated as categories: every feed nested
+// under them is tagged with the category's name.
+func ImportOPML(path string, db *gorm.DB) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("couldnt open %s: %w", path, err)
+	}
+	defer f.Close()
+
+	var doc opml
+	if err := xml.NewDecoder(f).Decode(&doc); err != nil {
+		return fmt.Errorf("couldnt parse OPML from %s: %w", path, err)
+	}
+
+	for _, o := range doc.Body.Outlines {
+		if err := importOutline(db, o, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func importOutline(db *gorm.DB, o outline, tags []string) error {
+	if o.XMLURL != "" {
+		title := o.Text
+		if title == "" {
+			title = o.Title
+		}
+		feed := &Feed{
+			URL:             o.XMLURL,
+			Title:           title,
+			LastCheckedTime: time.Time{},
+		}
+		if err := db.Create(feed).Error; err != nil {
+			return fmt.Errorf("couldnt create feed for %s: %w", o.XMLURL, err)
+		}
+		for _, tagName := range tags {
+			if err := TagFeed(db, feed.ID, tagName); err != nil {
+				return fmt.Errorf("couldnt tag feed %s with %q: %w", o.XMLURL, tagName, err)
+			}
+		}
+		return nil
+	}
+
+	// No xmlUrl: this outline is a category. Recurse into its children,
+	// tagging each descendant feed with its name.
+	childTags := append(append([]string{}, tags...), o.Text)
+	for _, child := range o.Outlines {
+		if err := importOutline(db, child, childTags); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ExportOPML writes every Feed in db to path as an OPML subscription
+// list. Feeds with one or more tags are nested under an outline per
+// tag; untagged feeds are written at the top level.
+func ExportOPML(path string, db *gorm.DB) error {
+	feeds, err := LoadFeeds(db)
+	if err != nil {
+		return fmt.Errorf("couldnt load feeds: %w", err)
+	}
+
+	doc := opml{Version: "2.0", Head: opmlHead{Title: "Feed export"}}
+	byTag := map[string][]outline{}
+	var untagged []outline
+
+	for _, feed := range feeds {
+		name := feed.Title
+		if name == "" {
+			name = feed.URL
+		}
+		o := outline{Text: name, XMLURL: feed.URL}
+
+		var tagged []Tag
+		if err := db.Model(&feed).Association("Tags").Find(&tagged); err != nil {
+			return fmt.Errorf("couldnt load tags for feed %d: %w", feed.ID, err)
+		}
+
+		if len(tagged) == 0 {
+			untagged = append(untagged, o)
+			continue
+		}
+		for _, t := range tagged {
+			byTag[t.Name] = append(byTag[t.Name], o)
+		}
+	}
+
+	for tagName, outlines := range byTag {
+		doc.Body.Outlines = append(doc.Body.Outlines, outline{
+			Text:     tagName,
+			Title:    tagName,
+			Outlines: outlines,
+		})
+	}
+	doc.Body.Outlines = append(doc.Body.Outlines, untagged...)
+
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("couldnt create %s: %w", path, err)
+	}
+	defer f.Close()
+
+	if _, err := f.WriteString(xml.Header); err != nil {
+		return fmt.Errorf("couldnt write OPML to %s: %w", path, err)
+	}
+
+	enc := xml.NewEncoder(f)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return fmt.Errorf("couldnt write OPML to %s: %w", path, err)
+	}
+	log.Printf("Exported %d feeds to %s", len(feeds), path)
+	return nil
+}
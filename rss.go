@@ -6,11 +6,13 @@ import (
 	"flag"
 	"fmt"
 	"log"
-	"math"
+	"net/http"
 	"os"
 	"sort"
 	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/blevesearch/bleve"
@@ -21,14 +23,17 @@ import (
 
 type Article struct {
 	gorm.Model
-	Read        bool      `json:"read"`
-	Title       string    `json:"title"`
-	Link        string    `json:"link"`
-	Description string    `json:"description"`
-	Published   time.Time `json:"published"`
-	Fetched     time.Time `json:"fetched"`
-	FeedID      int       `json:"feed"`
-	Feed        Feed
+	Read         bool      `json:"read"`
+	Title        string    `json:"title"`
+	Link         string    `json:"link"`
+	Description  string    `json:"description"`
+	Content      string    `json:"content"`       // readability-cleaned HTML, populated by enrich
+	PlainContent string    `json:"plain_content"` // plaintext of Content, the primary search field once enriched
+	Published    time.Time `json:"published"`
+	Fetched      time.Time `json:"fetched"`
+	FeedID       int       `json:"feed"`
+	Feed         Feed
+	Tags         []Tag `json:"tags" gorm:"many2many:article_tags;"`
 }
 
 func (a *Article) String() string {
@@ -39,7 +44,9 @@ func (a *Article) String() string {
 type Feed struct {
 	gorm.Model
 	URL             string    `json:"url"`
+	Title           string    `json:"title"`
 	LastCheckedTime time.Time `json:"last_checked_time"`
+	Tags            []Tag     `json:"tags" gorm:"many2many:feed_tags;"`
 }
 
 func LoadArticle(db *gorm.DB, ID int) (a *Article, err error) {
@@ -77,7 +84,7 @@ func InitDB(filepath string) *gorm.DB {
 		log.Fatal("db nil")
 	}
 
-	db.AutoMigrate(&Article{}, &Feed{})
+	db.AutoMigrate(&Article{}, &Feed{}, &Tag{}, &FetchState{}, &Delivered{})
 
 	return db
 }
@@ -108,34 +115,65 @@ func CheckNewArticles(db *gorm.DB, feed *Feed) ([]Article, error) {
 
 	//log.Printf("Last check time: %v", feed.LastCheckedTime)
 	checkTime := time.Now()
+
+	fetchState, err := LoadFetchState(db, feed.ID)
+	if err != nil {
+		return nil, fmt.Errorf("couldnt load fetch state for feed %d: %w", feed.ID, err)
+	}
+
+	transport := &conditionalTransport{
+		ifNoneMatch:     fetchState.ETag,
+		ifModifiedSince: fetchState.LastModified,
+	}
 	fp := gofeed.NewParser()
+	fp.Client = &http.Client{Transport: transport}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
 	rss, err := fp.ParseURLWithContext(feed.URL, ctx)
 	if err != nil {
+		if httpErr, ok := err.(gofeed.HTTPError); ok && httpErr.StatusCode == http.StatusNotModified {
+			VerboseLog("Feed %v not modified since last check", feed.URL)
+			feed.LastCheckedTime = checkTime
+			db.Save(&feed)
+			db.Save(fetchState)
+			return nil, nil
+		}
 		return nil, fmt.Errorf("couldnt parse %v: %w", feed.URL, err)
 	}
 
 	var articles []Article
 	for _, item := range rss.Items {
-		pubDate, err := attemptTimeParse(dateFormats, item.Published)
-		if err != nil {
-			log.Printf("Error parsing date (%v): %s", item.Published, err)
+		hash := ContentHash(item.GUID, item.Link, item.Title, item.Published)
+		if fetchState.HasSeen(hash) {
 			continue
 		}
-		if pubDate.After(feed.LastCheckedTime) {
-			//	log.Printf("New article found: feedID=%d pubDate=%v title=%s", feed.ID, pubDate, item.Title)
-			articles = append(articles, Article{
-				Title:       item.Title,
-				Read:        false,
-				Link:        item.Link,
-				Description: item.Description,
-				Published:   pubDate,
-				Fetched:     checkTime,
-			})
+
+		pubDate, err := attemptTimeParse(dateFormats, item.Published)
+		if err != nil {
+			log.Printf("Error parsing date (%v), using fetch time instead: %s", item.Published, err)
+			pubDate = checkTime
 		}
+
+		//	log.Printf("New article found: feedID=%d pubDate=%v title=%s", feed.ID, pubDate, item.Title)
+		articles = append(articles, Article{
+			Title:       item.Title,
+			Read:        false,
+			Link:        item.Link,
+			Description: item.Description,
+			Published:   pubDate,
+			Fetched:     checkTime,
+		})
+		fetchState.MarkSeen(hash)
+	}
+
+	fetchState.ETag = transport.etag
+	fetchState.LastModified = transport.lastModified
+	db.Save(fetchState)
+
+	if rss.Title != "" {
+		feed.Title = rss.Title
 	}
 	feed.LastCheckedTime = checkTime
 	db.Save(&feed) // TODO: wasteful to save everything
@@ -169,17 +207,14 @@ func VerboseLog(format string, v ...interface{}) {
 	}
 }
 
-func indexArticles(db *gorm.DB, index bleve.Index) error {
+func indexArticles(db *gorm.DB, index bleve.Index, batchSize int) error {
 	articles, err := LoadArticles(db, true, 5000)
 	if err != nil {
 		return fmt.Errorf("db loading error: %v", err)
 	}
 	log.Printf("Indexing %d articles from db...", len(articles))
 
-	for _, a := range articles {
-		index.Index(fmt.Sprintf("%d", a.ID), a) // TODO: is there no way to make the key an int?
-	}
-	return nil
+	return batchIndexArticles(index, articles, batchSize)
 }
 
 func printArticles(db *gorm.DB, printRead bool) error {
@@ -201,7 +236,7 @@ func printArticles(db *gorm.DB, printRead bool) error {
 	return nil
 }
 
-func updateFeeds(db *gorm.DB, index bleve.Index) error {
+func updateFeeds(db *gorm.DB, index bleve.Index, batchSize int) error {
 	feeds, err := LoadFeeds(db)
 	if err != nil {
 		return fmt.Errorf("Error loading feeds from db: %v", err)
@@ -209,11 +244,21 @@ func updateFeeds(db *gorm.DB, index bleve.Index) error {
 
 	log.Printf("Updating %d feeds", len(feeds))
 
+	articleCh := make(chan Article)
+	var indexWG sync.WaitGroup
+	indexWG.Add(1)
+	go func() {
+		defer indexWG.Done()
+		if err := batchIndexChannel(index, articleCh, batchSize); err != nil {
+			log.Printf("Error batch indexing fetched articles: %v", err)
+		}
+	}()
+
+	var newCount int64
 	var wg sync.WaitGroup
 	for _, feed := range feeds {
 		wg.Add(1)
 		go func(feed Feed) {
-			newCount := 0
 			defer wg.Done()
 			// Check for new articles and return a list of articles plus update the db
 			newArticles, err := CheckNewArticles(db, &feed)
@@ -226,34 +271,53 @@ func updateFeeds(db *gorm.DB, index bleve.Index) error {
 				log.Printf("Retrieved %d articles from %v", len(newArticles), feed.URL)
 				//log.Printf("feed %d: %v\n", i, feed)
 
-				// Iterate over the articles and print them
+				var feedTags []Tag
+				if err := db.Model(&feed).Association("Tags").Find(&feedTags); err != nil {
+					log.Printf("Error loading tags for feed %d: %v", feed.ID, err)
+				}
+
+				// Iterate over the articles, save them, and hand them off to the indexer
 				for _, article := range newArticles {
 					article.Feed = feed
+					article.Tags = feedTags
 					db.Create(&article)
-					index.Index(fmt.Sprint(article.ID), article)
-					newCount = newCount + 1
+					articleCh <- article
+					atomic.AddInt64(&newCount, 1)
 				}
 			}
 		}(feed)
 	}
 	wg.Wait()
+	close(articleCh)
+	indexWG.Wait()
+	log.Printf("Fetched %d new articles", newCount)
 	log.Printf("All checks done")
 	return nil
 }
 
-func searchArticles(db *gorm.DB, index bleve.Index, args []string) error {
-	weightScore := func(score, age float64) float64 {
-		la := -math.Log(age)
-		recip := 1 / la
-		ws := score + recip
-		VerboseLog("index score=%.3v, age=%.6v, log(age)=%.5v, f*1/log(age)=%.6v, wscore=%.3v\n", score, age, la, recip, ws)
-		return ws
+func searchArticles(db *gorm.DB, index bleve.Index, tagFilter string, decayName string, halfLife, floor float64, args []string) error {
+	decay, err := lookupDecayFunc(decayName)
+	if err != nil {
+		return err
 	}
+
+	var allowedFeedIDs map[uint]bool
+	if tagFilter != "" {
+		feedIDs, err := FeedIDsForTag(db, tagFilter)
+		if err != nil {
+			return fmt.Errorf("couldnt resolve tag %q: %w", tagFilter, err)
+		}
+		allowedFeedIDs = make(map[uint]bool, len(feedIDs))
+		for _, id := range feedIDs {
+			allowedFeedIDs[id] = true
+		}
+	}
+
 	if len(args) > 0 {
 		query := bleve.NewQueryStringQuery(args[0])
 		searchRequest := bleve.NewSearchRequest(query) // Eventually pass our scoring into bleve? does it have access to date?
 		searchResults, _ := index.Search(searchRequest)
-		var sortedResults byWeightedScore
+		var sortedResults byFinalScore
 		for _, hit := range searchResults.Hits {
 			id, err := strconv.Atoi(hit.ID)
 			if err == nil {
@@ -261,25 +325,17 @@ func searchArticles(db *gorm.DB, index bleve.Index, args []string) error {
 				if err != nil {
 					return fmt.Errorf("error converting search result %v: %w", id, err)
 				} else {
-					age := time.Since(article.Published).Hours() / 24
-					s := scoredArticle{article: article, score: hit.Score, weightedScore: weightScore(hit.Score, age), age: age}
-					sortedResults = append(sortedResults, s)
-
-					VerboseLog("score=%.3v, %s, %s\n", hit.Score, article.Published, article.Title)
-					VerboseLog("---")
+					if allowedFeedIDs != nil && !allowedFeedIDs[uint(article.FeedID)] {
+						continue
+					}
+					sortedResults = append(sortedResults, scoreArticle(article, hit.Score, decay, halfLife, floor))
 				}
 			}
 		}
-		sort.Sort(byWeightedScore(sortedResults))
+		sort.Sort(byFinalScore(sortedResults))
 		log.Printf("--- Sorted ---")
 		for _, sa := range sortedResults {
-			//ws := weightScore(sa.score, sa.age)
-			//text, err := html2text.FromString(sa.article.Description, html2text.Options{PrettyTables: true})
-			//if err != nil {
-			//	continue
-			//}
-			log.Printf("score=%.3v, date=%v, title=%s\n", sa.weightedScore, sa.article.Published, sa.article.Title)
-			//log.Printf("\t%s", text)
+			log.Printf("final=%.3v (bm25=%.3v, decay=%.3v), date=%v, title=%s\n", sa.final, sa.bm25, sa.decay, sa.article.Published, sa.article.Title)
 		}
 	} else {
 		log.Fatalf("Usage: search <search string>")
@@ -288,19 +344,6 @@ func searchArticles(db *gorm.DB, index bleve.Index, args []string) error {
 	return nil
 }
 
-type scoredArticle struct {
-	article       *Article
-	age           float64
-	score         float64
-	weightedScore float64
-}
-
-type byWeightedScore []scoredArticle
-
-func (a byWeightedScore) Len() int           { return len(a) }
-func (a byWeightedScore) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
-func (a byWeightedScore) Less(i, j int) bool { return a[i].weightedScore > a[j].weightedScore }
-
 var _verbose bool
 
 func main() {
@@ -322,8 +365,7 @@ func main() {
 
 	index, err = bleve.Open("_bleve")
 	if err == bleve.ErrorIndexPathDoesNotExist {
-		mapping := bleve.NewIndexMapping()
-		index, err = bleve.New("_bleve", mapping)
+		index, err = bleve.New("_bleve", buildIndexMapping())
 		if err != nil {
 			log.Fatalf("index creation error: %v", err)
 		}
@@ -334,21 +376,62 @@ func main() {
 	// Parse subcommand
 	args := flag.Args()
 	if len(args) == 0 {
-		log.Fatal("Please specify a subcommand: search, index, fetch, refresh, prune, unread, import")
+		log.Fatal("Please specify a subcommand: search, index, fetch, refresh, enrich, prune, unread, import, export, tag, untag, list-tags, deliver")
 	}
 	cmd, args := args[0], args[1:]
 
 	switch cmd {
 	case "search":
-		searchArticles(db, index, args)
+		searchFlags := flag.NewFlagSet("search", flag.ExitOnError)
+		tagFilter := searchFlags.String("tag", "", "only search articles from feeds tagged with this category")
+		decayName := searchFlags.String("decay", "exponential", "freshness decay function: exponential, gaussian, or linear")
+		halfLifeStr := searchFlags.String("halflife", "7d", "age at which an article's score has decayed by half, e.g. 7d, 36h")
+		floor := searchFlags.Float64("floor", 0.05, "minimum decay multiplier applied to very old articles")
+		searchFlags.Parse(args)
+
+		halfLife, err := parseHalfLife(*halfLifeStr)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := searchArticles(db, index, *tagFilter, *decayName, halfLife, *floor, searchFlags.Args()); err != nil {
+			log.Fatalf("Error searching articles: %v", err)
+		}
 
 	case "index":
-		indexArticles(db, index)
+		indexFlags := flag.NewFlagSet("index", flag.ExitOnError)
+		batchSize := indexFlags.Int("batch-size", defaultIndexBatchSize, "number of documents to accumulate before flushing a bleve batch")
+		indexFlags.Parse(args)
+
+		indexArticles(db, index, *batchSize)
 	case "fetch":
-		updateFeeds(db, index)
+		fetchFlags := flag.NewFlagSet("fetch", flag.ExitOnError)
+		enrich := fetchFlags.Bool("enrich", false, "run readability extraction on new articles after fetching")
+		batchSize := fetchFlags.Int("batch-size", defaultIndexBatchSize, "number of documents to accumulate before flushing a bleve batch")
+		fetchFlags.Parse(args)
+
+		updateFeeds(db, index, *batchSize)
+		if *enrich {
+			if err := enrichArticles(db, index, enrichConcurrency, enrichTimeout, enrichHostInterval); err != nil {
+				log.Fatalf("Error enriching articles: %v", err)
+			}
+		}
 	case "refresh":
-		updateFeeds(db, index)
-		indexArticles(db, index)
+		refreshFlags := flag.NewFlagSet("refresh", flag.ExitOnError)
+		batchSize := refreshFlags.Int("batch-size", defaultIndexBatchSize, "number of documents to accumulate before flushing a bleve batch")
+		refreshFlags.Parse(args)
+
+		updateFeeds(db, index, *batchSize)
+		indexArticles(db, index, *batchSize)
+	case "enrich":
+		enrichFlags := flag.NewFlagSet("enrich", flag.ExitOnError)
+		concurrency := enrichFlags.Int("concurrency", enrichConcurrency, "maximum number of articles to fetch concurrently")
+		timeout := enrichFlags.Duration("timeout", enrichTimeout, "per-article fetch timeout")
+		hostInterval := enrichFlags.Duration("host-interval", enrichHostInterval, "minimum time between requests to the same host")
+		enrichFlags.Parse(args)
+
+		if err := enrichArticles(db, index, *concurrency, *timeout, *hostInterval); err != nil {
+			log.Fatalf("Error enriching articles: %v", err)
+		}
 	case "prune":
 		db.Where("id NOT IN (?)", db.Model(&Article{}).Select("feed_id").Where("feed_id IS NOT NULL")).Delete(&Feed{})
 	case "unread":
@@ -363,16 +446,63 @@ func main() {
 
 	case "import":
 		if len(args) > 0 {
-			err := CreateFeeds(args[0], db)
+			var err error
+			if strings.HasSuffix(args[0], ".opml") || strings.HasSuffix(args[0], ".xml") {
+				err = ImportOPML(args[0], db)
+			} else {
+				err = CreateFeeds(args[0], db)
+			}
 			if err != nil {
 				log.Fatalf("Error adding feeds to db: %v", err)
 			}
 		} else {
-			log.Fatalf("Usage: add <filename>")
+			log.Fatalf("Usage: import <filename.opml|filename.txt>")
+		}
+	case "export":
+		if len(args) > 0 {
+			if err := ExportOPML(args[0], db); err != nil {
+				log.Fatalf("Error exporting feeds: %v", err)
+			}
+		} else {
+			log.Fatalf("Usage: export <filename.opml>")
+		}
+	case "tag":
+		if len(args) != 2 {
+			log.Fatalf("Usage: tag <feed id> <tag name>")
+		}
+		feedID, err := strconv.Atoi(args[0])
+		if err != nil {
+			log.Fatalf("Invalid feed id %q: %v", args[0], err)
+		}
+		if err := TagFeed(db, uint(feedID), args[1]); err != nil {
+			log.Fatalf("Error tagging feed: %v", err)
+		}
+	case "untag":
+		if len(args) != 2 {
+			log.Fatalf("Usage: untag <feed id> <tag name>")
+		}
+		feedID, err := strconv.Atoi(args[0])
+		if err != nil {
+			log.Fatalf("Invalid feed id %q: %v", args[0], err)
+		}
+		if err := UntagFeed(db, uint(feedID), args[1]); err != nil {
+			log.Fatalf("Error untagging feed: %v", err)
+		}
+	case "list-tags":
+		if err := printTags(db); err != nil {
+			log.Fatalf("Error listing tags: %v", err)
+		}
+	case "deliver":
+		cfg, folderTemplate, err := deliverFlags(args)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := deliverArticles(db, cfg, folderTemplate); err != nil {
+			log.Fatalf("Error delivering articles: %v", err)
 		}
 	default:
 		log.Fatalf("Unrecognized command %q. "+
-			"Command must be one of: update, unread", cmd)
+			"Command must be one of: search, index, fetch, refresh, enrich, prune, unread, import, export, tag, untag, list-tags, deliver", cmd)
 	}
 
 }
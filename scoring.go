@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// decayFunc maps an article's age (in days) to a multiplier in (0, 1]
+// that's applied to its raw search score. halfLife and floor are the
+// knobs exposed on the `search` command.
+type decayFunc func(ageDays, halfLife, floor float64) float64
+
+// exponentialDecay is the standard time-decay used by Elasticsearch/Solr
+// function-score queries: finalScore = bm25 * exp(-ln(2) * age / halfLife).
+// Unlike 1/-log(age), it's well-defined for age<=1 and never produces a
+// negative or blown-up weight; the result is clamped to [floor, 1] so a
+// future or clock-skewed Published date can't inflate the score either.
+func exponentialDecay(ageDays, halfLife, floor float64) float64 {
+	decay := math.Exp(-math.Ln2 * ageDays / halfLife)
+	if decay > 1 {
+		return 1
+	}
+	if decay < floor {
+		return floor
+	}
+	return decay
+}
+
+// gaussianDecay scores age on a bell curve tuned so that an article
+// exactly halfLife days old decays to 0.5, falling off faster than
+// exponentialDecay beyond that point.
+func gaussianDecay(ageDays, halfLife, floor float64) float64 {
+	sigma := halfLife / math.Sqrt(2*math.Ln2)
+	decay := math.Exp(-(ageDays * ageDays) / (2 * sigma * sigma))
+	if decay < floor {
+		return floor
+	}
+	return decay
+}
+
+// linearDecay falls off linearly from 1 at age=0 to floor at
+// age=2*halfLife, then holds at floor.
+func linearDecay(ageDays, halfLife, floor float64) float64 {
+	maxAge := 2 * halfLife
+	if ageDays >= maxAge {
+		return floor
+	}
+	decay := 1 - (ageDays/maxAge)*(1-floor)
+	if decay > 1 {
+		return 1
+	}
+	if decay < floor {
+		return floor
+	}
+	return decay
+}
+
+var decayFuncs = map[string]decayFunc{
+	"exponential": exponentialDecay,
+	"gaussian":    gaussianDecay,
+	"linear":      linearDecay,
+}
+
+func lookupDecayFunc(name string) (decayFunc, error) {
+	f, ok := decayFuncs[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown decay function %q (want one of exponential, gaussian, linear)", name)
+	}
+	return f, nil
+}
+
+// parseHalfLife parses a duration like "7d", "36h" or "90m" into days.
+// time.ParseDuration doesn't understand "d", so we handle that suffix
+// ourselves and defer to it for everything else. The result must be
+// positive: a zero or negative half-life divides by zero (or flips the
+// sign of) the exponent in exponentialDecay/gaussianDecay, producing
+// NaN or an inverted ranking.
+func parseHalfLife(s string) (float64, error) {
+	days, err := parseHalfLifeDays(s)
+	if err != nil {
+		return 0, err
+	}
+	if days <= 0 {
+		return 0, fmt.Errorf("invalid half-life %q: must be positive", s)
+	}
+	return days, nil
+}
+
+func parseHalfLifeDays(s string) (float64, error) {
+	if strings.HasSuffix(s, "d") {
+		days, err := strconv.ParseFloat(strings.TrimSuffix(s, "d"), 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid half-life %q: %w", s, err)
+		}
+		return days, nil
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid half-life %q: %w", s, err)
+	}
+	return d.Hours() / 24, nil
+}
+
+// scoredArticle carries the component scores that went into ranking
+// an article, so -verbose output can show bm25/decay/final separately.
+type scoredArticle struct {
+	article *Article
+	age     float64
+	bm25    float64
+	decay   float64
+	final   float64
+}
+
+func scoreArticle(article *Article, bm25 float64, decay decayFunc, halfLife, floor float64) scoredArticle {
+	ageDays := time.Since(article.Published).Hours() / 24
+	d := decay(ageDays, halfLife, floor)
+	final := bm25 * d
+	VerboseLog("bm25=%.4v, age_days=%.3v, decay=%.4v, final=%.4v, title=%s", bm25, ageDays, d, final, article.Title)
+	return scoredArticle{article: article, age: ageDays, bm25: bm25, decay: d, final: final}
+}
+
+type byFinalScore []scoredArticle
+
+func (a byFinalScore) Len() int           { return len(a) }
+func (a byFinalScore) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a byFinalScore) Less(i, j int) bool { return a[i].final > a[j].final }
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"gorm.io/gorm"
+)
+
+// Tag is a user-defined category that Feeds (and the Articles fetched
+// from them) can be grouped under, roughly analogous to a folder in
+// other feed readers.
+type Tag struct {
+	gorm.Model
+	Name  string `json:"name" gorm:"uniqueIndex"`
+	Feeds []Feed `json:"-" gorm:"many2many:feed_tags;"`
+}
+
+func FindOrCreateTag(db *gorm.DB, name string) (*Tag, error) {
+	var tag Tag
+	if err := db.Where(&Tag{Name: name}).FirstOrCreate(&tag, &Tag{Name: name}).Error; err != nil {
+		return nil, err
+	}
+	return &tag, nil
+}
+
+// TagFeed adds tagName to feed, creating the tag if it doesn't already exist.
+func TagFeed(db *gorm.DB, feedID uint, tagName string) error {
+	var feed Feed
+	if err := db.First(&feed, feedID).Error; err != nil {
+		return fmt.Errorf("couldnt load feed %d: %w", feedID, err)
+	}
+
+	tag, err := FindOrCreateTag(db, tagName)
+	if err != nil {
+		return fmt.Errorf("couldnt find or create tag %q: %w", tagName, err)
+	}
+
+	return db.Model(&feed).Association("Tags").Append(tag)
+}
+
+// UntagFeed removes tagName from feed. It is not an error to untag a
+// feed that was never tagged.
+func UntagFeed(db *gorm.DB, feedID uint, tagName string) error {
+	var feed Feed
+	if err := db.First(&feed, feedID).Error; err != nil {
+		return fmt.Errorf("couldnt load feed %d: %w", feedID, err)
+	}
+
+	var tag Tag
+	if err := db.Where(&Tag{Name: tagName}).First(&tag).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil
+		}
+		return err
+	}
+
+	return db.Model(&feed).Association("Tags").Delete(&tag)
+}
+
+// ListTags returns every known tag. It does not load or count the
+// feeds that carry each tag; printTags counts those separately.
+func ListTags(db *gorm.DB) ([]Tag, error) {
+	var tags []Tag
+	if err := db.Find(&tags).Error; err != nil {
+		return nil, err
+	}
+	return tags, nil
+}
+
+// FeedIDsForTag returns the IDs of every feed tagged with tagName.
+func FeedIDsForTag(db *gorm.DB, tagName string) ([]uint, error) {
+	var tag Tag
+	if err := db.Where(&Tag{Name: tagName}).First(&tag).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var feeds []Feed
+	if err := db.Model(&tag).Association("Feeds").Find(&feeds); err != nil {
+		return nil, err
+	}
+
+	ids := make([]uint, len(feeds))
+	for i, f := range feeds {
+		ids[i] = f.ID
+	}
+	return ids, nil
+}
+
+func printTags(db *gorm.DB) error {
+	tags, err := ListTags(db)
+	if err != nil {
+		return fmt.Errorf("error loading tags: %w", err)
+	}
+	for _, t := range tags {
+		count := db.Model(&t).Association("Feeds").Count()
+		log.Printf("%s (%d feeds)", t.Name, count)
+	}
+	return nil
+}